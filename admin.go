@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// adminQueryDuration tracks how long the exporter itself spends waiting on
+// ProxySQL's admin interface, so operators can alert when the exporter is
+// slowing down its target rather than only seeing that symptom downstream.
+var adminQueryDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "proxysql_exporter_admin_query_duration_seconds",
+		Help: "Duration of admin SQL queries issued by the exporter, by query.",
+	},
+	[]string{"query"},
+)
+
+func init() {
+	prometheus.MustRegister(adminQueryDuration)
+}
+
+// observeAdminQuery records the duration of an admin query against
+// adminQueryDuration and, if it exceeded threshold, logs the rendered SQL
+// along with the row count and elapsed time.
+func observeAdminQuery(logger *slog.Logger, threshold time.Duration, queryName, sql string, start time.Time, rowCount int) {
+	elapsed := time.Since(start)
+	adminQueryDuration.WithLabelValues(queryName).Observe(elapsed.Seconds())
+
+	if elapsed > threshold {
+		logger.Warn("Slow admin query",
+			"query", queryName,
+			"sql", sql,
+			"rows", rowCount,
+			"duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", threshold.Milliseconds(),
+		)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// upDesc reports whether the last scrape of the target ProxySQL admin
+// interface succeeded.
+var upDesc = prometheus.NewDesc(
+	"proxysql_up",
+	"Whether the last scrape of ProxySQL was successful",
+	nil, nil,
+)
+
+var scrapeDurationLabels = []string{"collector"}
+
+var (
+	scrapeDurationDesc = prometheus.NewDesc(
+		"proxysql_scrape_collector_duration_seconds",
+		"proxysql_exporter: time each subcollector took to scrape",
+		scrapeDurationLabels, nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		"proxysql_scrape_collector_success",
+		"proxysql_exporter: whether a subcollector scrape succeeded",
+		scrapeDurationLabels, nil,
+	)
+)
+
+// subcollector is one named piece of work a Collector can run per scrape,
+// e.g. the connection_pool or query_digest query. Splitting it out lets
+// callers select a subset via the collect[] URL parameter.
+type subcollector struct {
+	name    string
+	collect func(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error
+}
+
+// Collector runs the ProxySQL admin-interface queries on demand and emits
+// fresh metrics for a single scrape, instead of relying on package-level
+// GaugeVecs populated by a background loop. One Collector is created per
+// target, either for the single DSN given at startup or for a target
+// requested through /probe.
+type Collector struct {
+	ctx           context.Context
+	db            *sql.DB
+	subcollectors []subcollector
+	// enabled restricts which subcollectors run, selected by name via the
+	// collect[] URL parameter. A nil map means "run everything".
+	enabled map[string]bool
+	logger  *slog.Logger
+	// adminSlowThreshold is passed to each subcollector so it can log (and
+	// attribute to adminQueryDuration) admin queries that run long.
+	adminSlowThreshold time.Duration
+}
+
+// NewCollector returns a Collector that scrapes db using the given
+// query_digest options. enabled selects which subcollectors to run by name
+// ("connection_pool", "query_digest"); pass nil to run all of them.
+// adminSlowThreshold is the --admin.slow-threshold value used to flag slow
+// admin queries. ctx is passed to every admin query via QueryContext, so a
+// request-scoped context (as /probe uses) lets a disconnecting client or a
+// scrape timeout cancel an in-flight query instead of leaking it.
+func NewCollector(ctx context.Context, db *sql.DB, queryDigestOpts QueryDigestOptions, enabled map[string]bool, adminSlowThreshold time.Duration, logger *slog.Logger) *Collector {
+	return &Collector{
+		ctx: ctx,
+		db:  db,
+		subcollectors: []subcollector{
+			{name: "connection_pool", collect: collectConnectionPool},
+			{name: "query_digest", collect: func(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+				return collectQueryDigest(ctx, logger, threshold, db, queryDigestOpts, ch)
+			}},
+			{name: "mysql_global", collect: collectGlobal},
+			{name: "memory_metrics", collect: collectMemoryMetrics},
+			{name: "commands_counters", collect: collectCommandsCounters},
+			{name: "mysql_users", collect: collectMySQLUsers},
+		},
+		enabled:            enabled,
+		logger:             logger,
+		adminSlowThreshold: adminSlowThreshold,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	ch <- scrapeDurationDesc
+	ch <- scrapeSuccessDesc
+	describeConnectionPool(ch)
+	describeQueryDigest(ch)
+	describeGlobal(ch)
+	describeMemoryMetrics(ch)
+	describeCommandsCounters(ch)
+	describeMySQLUsers(ch)
+}
+
+// Collect implements prometheus.Collector. It runs each enabled subcollector
+// against ProxySQL's admin interface and emits the results as fresh metrics,
+// so stale label series (e.g. a server that has been removed from a
+// hostgroup) do not linger between scrapes.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	up := 1.0
+
+	for _, sc := range c.subcollectors {
+		if c.enabled != nil && !c.enabled[sc.name] {
+			continue
+		}
+
+		start := time.Now()
+		err := sc.collect(c.ctx, c.logger, c.adminSlowThreshold, c.db, ch)
+		duration := time.Since(start).Seconds()
+
+		success := 1.0
+		if err != nil {
+			c.logger.Error("Subcollector scrape failed", "collector", sc.name, "duration_ms", duration*1000, "err", err)
+			success = 0
+			up = 0
+		}
+
+		ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration, sc.name)
+		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, sc.name)
+	}
+
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up)
+}
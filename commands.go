@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var commandsCountersLabels = []string{"command"}
+
+// commandsCountersDesc is a histogram built from stats.stats_mysql_commands_counters'
+// cnt_* columns. Each cnt_X is the count of commands whose latency fell in
+// that exclusive range (e.g. cnt_500us counts commands between 100us and
+// 500us), so collectCommandsCounters prefix-sums them into the cumulative
+// per-bucket counts prometheus.MustNewConstHistogram expects.
+var commandsCountersDesc = prometheus.NewDesc(
+	"proxysql_command_duration_seconds",
+	"Latency histogram of commands processed by ProxySQL, from stats.stats_mysql_commands_counters.",
+	commandsCountersLabels, nil,
+)
+
+func describeCommandsCounters(ch chan<- *prometheus.Desc) {
+	ch <- commandsCountersDesc
+}
+
+// collectCommandsCounters retrieves stats.stats_mysql_commands_counters and
+// emits one histogram per command.
+func collectCommandsCounters(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	query := `select Command, Total_Time_us, Total_cnt,
+		cnt_100us, cnt_500us, cnt_1ms, cnt_5ms, cnt_10ms, cnt_50ms, cnt_100ms, cnt_500ms, cnt_1s, cnt_5s, cnt_10s, cnt_INFs
+	from stats.stats_mysql_commands_counters`
+	logger.Debug("Executing commands_counters query", "sql", query)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "commands_counters", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var (
+			command                                                                                                 string
+			totalTimeUs, totalCnt                                                                                   uint64
+			cnt100us, cnt500us, cnt1ms, cnt5ms, cnt10ms, cnt50ms, cnt100ms, cnt500ms, cnt1s, cnt5s, cnt10s, cntINFs uint64
+		)
+		err = rows.Scan(&command, &totalTimeUs, &totalCnt,
+			&cnt100us, &cnt500us, &cnt1ms, &cnt5ms, &cnt10ms, &cnt50ms, &cnt100ms, &cnt500ms, &cnt1s, &cnt5s, &cnt10s, &cntINFs)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("commands_counters row", "command", command, "total_cnt", totalCnt)
+
+		// cnt_X columns are exclusive per-range counts; prefix-sum them in
+		// ascending order of upper bound to get the cumulative per-bucket
+		// counts a Prometheus histogram requires.
+		var cumulative uint64
+		buckets := make(map[float64]uint64, 12)
+		for _, b := range []struct {
+			le    float64
+			count uint64
+		}{
+			{0.0001, cnt100us},
+			{0.0005, cnt500us},
+			{0.001, cnt1ms},
+			{0.005, cnt5ms},
+			{0.01, cnt10ms},
+			{0.05, cnt50ms},
+			{0.1, cnt100ms},
+			{0.5, cnt500ms},
+			{1, cnt1s},
+			{5, cnt5s},
+			{10, cnt10s},
+			{math.Inf(1), cntINFs},
+		} {
+			cumulative += b.count
+			buckets[b.le] = cumulative
+		}
+
+		ch <- prometheus.MustNewConstHistogram(commandsCountersDesc, totalCnt, float64(totalTimeUs)/1e6, buckets, command)
+	}
+	return rows.Err()
+}
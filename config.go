@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v2"
+)
+
+// targetPattern constrains the /probe?target= value to a bare host:port (or
+// [ipv6]:port), the same way blackbox_exporter and postgres_exporter
+// restrict their target parameter, so it cannot be used to inject extra
+// go-sql-driver/mysql DSN syntax (e.g. a target of
+// "127.0.0.1:6032)/x?allowAllFiles=true" breaking out of the tcp(...)
+// address component).
+var targetPattern = regexp.MustCompile(`^(\[[0-9A-Fa-f:]+\]|[a-zA-Z0-9.-]+):[0-9]{1,5}$`)
+
+// AuthModule describes the credentials and connection options used to reach
+// a single ProxySQL admin interface. Named auth modules let operators keep
+// usernames/passwords out of the /probe URL.
+type AuthModule struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Options are appended verbatim to the DSN built for the scrape target,
+	// e.g. "timeout=5s" or "tls=skip-verify".
+	Options string `yaml:"options"`
+}
+
+// Config is the top-level structure of the --config.file YAML document.
+type Config struct {
+	AuthModules map[string]AuthModule `yaml:"auth_modules"`
+}
+
+// LoadConfig reads and parses the exporter's probe configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// DSN builds a go-sql-driver/mysql DSN for the given target using this auth
+// module's credentials. target must be a bare "host:port" (or
+// "[ipv6]:port"); it is rejected otherwise, since it comes straight from the
+// untrusted /probe?target= query parameter and is interpolated into the DSN.
+//
+// The DSN is built with mysql.Config.FormatDSN rather than fmt.Sprintf so a
+// username or password containing "@", ":" or "/" - common in generated
+// secrets - is escaped correctly instead of corrupting the driver's own
+// parsing of the DSN.
+func (m AuthModule) DSN(target string) (string, error) {
+	if !targetPattern.MatchString(target) {
+		return "", fmt.Errorf("invalid target %q: must be host:port", target)
+	}
+	cfg := mysql.Config{
+		User:   m.Username,
+		Passwd: m.Password,
+		Net:    "tcp",
+		Addr:   target,
+	}
+	dsn := cfg.FormatDSN()
+	if m.Options != "" {
+		dsn += "?" + m.Options
+	}
+	return dsn, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var connectionPoolLabels = []string{"hostgroup", "srv_host", "srv_port", "status"}
+
+// connectionErrorDesc, connectionOKDesc, queriesDesc, sentBytesDesc and
+// recvBytesDesc are cumulative counters in ProxySQL (they only grow until a
+// server is reset or removed); connectionUsedDesc, connectionFreeDesc and
+// latencyNsDesc are point-in-time gauges. Collect emits them with the
+// matching prometheus.ValueType accordingly.
+var (
+	connectionErrorDesc = prometheus.NewDesc(
+		"proxysql_conn_error",
+		"how many connections were not established successfully",
+		connectionPoolLabels, nil,
+	)
+	connectionOKDesc = prometheus.NewDesc(
+		"proxysql_conn_ok",
+		"how many connections were established successfully",
+		connectionPoolLabels, nil,
+	)
+	connectionUsedDesc = prometheus.NewDesc(
+		"proxysql_conn_used",
+		"how many connections are currently used by ProxySQL for sending queries to the backend server",
+		connectionPoolLabels, nil,
+	)
+	connectionFreeDesc = prometheus.NewDesc(
+		"proxysql_conn_free",
+		"how many connections are currently free. They are kept open in order to minimize the time cost of sending a query to the backend server",
+		connectionPoolLabels, nil,
+	)
+	queriesDesc = prometheus.NewDesc(
+		"proxysql_queries",
+		"the number of queries routed towards this particular backend server",
+		connectionPoolLabels, nil,
+	)
+	sentBytesDesc = prometheus.NewDesc(
+		"proxysql_sent_bytes",
+		"the amount of data sent to the backend. This does not include metadata (packets headers)",
+		connectionPoolLabels, nil,
+	)
+	recvBytesDesc = prometheus.NewDesc(
+		"proxysql_recv_bytes",
+		"the amount of data received from the backend. This does not include metadata (packets headers, OK/ERR packets, fields description, etc)",
+		connectionPoolLabels, nil,
+	)
+	latencyNsDesc = prometheus.NewDesc(
+		"proxysql_latency_ns",
+		"the current ping time in microseconds, as reported from Monitor",
+		connectionPoolLabels, nil,
+	)
+)
+
+func describeConnectionPool(ch chan<- *prometheus.Desc) {
+	ch <- connectionErrorDesc
+	ch <- connectionOKDesc
+	ch <- connectionUsedDesc
+	ch <- connectionFreeDesc
+	ch <- queriesDesc
+	ch <- sentBytesDesc
+	ch <- recvBytesDesc
+	ch <- latencyNsDesc
+}
+
+// collectConnectionPool retrieves stats from stats.stats_mysql_connection_pool
+// and emits one set of metrics per hostgroup/server/status row.
+func collectConnectionPool(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	query := fmt.Sprint(`select ifnull(hg.comment, cast(cp.hostgroup as varchar)) as hostgroup,
+		cp.srv_host, cp.srv_port, cp.status, cp.ConnUsed, cp.ConnFree, cp.ConnOK, cp.ConnERR, cp.MaxConnUsed, cp.Queries, cp.Queries_GTID_sync, cp.Bytes_data_sent, cp.Bytes_data_recv, cp.Latency_us
+	from stats.stats_mysql_connection_pool cp
+		left join runtime_mysql_replication_hostgroups hg on cp.hostgroup = hg.writer_hostgroup or cp.hostgroup = hg.reader_hostgroup`)
+	logger.Debug("Executing connection_pool query", "sql", query)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "connection_pool", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var (
+			hostgroup       string
+			srvHost         string
+			srvPort         int
+			status          string
+			ConnUsed        int
+			ConnFree        int
+			ConnOK          int
+			ConnERR         int
+			MaxConnUsed     int
+			Queries         int
+			QueriesGTIDSync int
+			BytesDataSent   int
+			BytesDataRecv   int
+			LatencyUs       int
+		)
+		err = rows.Scan(&hostgroup, &srvHost, &srvPort, &status, &ConnUsed, &ConnFree, &ConnOK, &ConnERR, &MaxConnUsed, &Queries, &QueriesGTIDSync, &BytesDataSent, &BytesDataRecv, &LatencyUs)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("connection_pool row", "hostgroup", hostgroup, "srv_host", srvHost, "srv_port", srvPort, "status", status)
+
+		labels := []string{hostgroup, srvHost, fmt.Sprintf("%v", srvPort), status}
+
+		ch <- prometheus.MustNewConstMetric(connectionErrorDesc, prometheus.CounterValue, float64(ConnERR), labels...)
+		ch <- prometheus.MustNewConstMetric(connectionOKDesc, prometheus.CounterValue, float64(ConnOK), labels...)
+		ch <- prometheus.MustNewConstMetric(connectionUsedDesc, prometheus.GaugeValue, float64(ConnUsed), labels...)
+		ch <- prometheus.MustNewConstMetric(connectionFreeDesc, prometheus.GaugeValue, float64(ConnFree), labels...)
+		ch <- prometheus.MustNewConstMetric(queriesDesc, prometheus.CounterValue, float64(Queries), labels...)
+		ch <- prometheus.MustNewConstMetric(sentBytesDesc, prometheus.CounterValue, float64(BytesDataSent), labels...)
+		ch <- prometheus.MustNewConstMetric(recvBytesDesc, prometheus.CounterValue, float64(BytesDataRecv), labels...)
+		ch <- prometheus.MustNewConstMetric(latencyNsDesc, prometheus.GaugeValue, float64(LatencyUs), labels...)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var globalStatusLabels = []string{"variable"}
+
+// globalStatusDesc is a generic gauge for any stats.stats_mysql_global
+// variable not listed in knownGlobalStatusMetrics below. ProxySQL's variable
+// list is open-ended and undocumented per-release, so unknown variables fall
+// back here rather than being dropped.
+var globalStatusDesc = prometheus.NewDesc(
+	"proxysql_global_status",
+	"Generic gauge for a stats.stats_mysql_global variable not otherwise recognized by this exporter.",
+	globalStatusLabels, nil,
+)
+
+var (
+	questionsDesc = prometheus.NewDesc(
+		"proxysql_questions_total",
+		"the total number of queries sent by clients, both SQL statements and commands",
+		nil, nil,
+	)
+	slowQueriesDesc = prometheus.NewDesc(
+		"proxysql_slow_queries_total",
+		"the total number of queries that ran for longer than mysql-long_query_time",
+		nil, nil,
+	)
+	clientConnectionsCreatedDesc = prometheus.NewDesc(
+		"proxysql_client_connections_created_total",
+		"the total number of frontend connections created",
+		nil, nil,
+	)
+	clientConnectionsAbortedDesc = prometheus.NewDesc(
+		"proxysql_client_connections_aborted_total",
+		"the total number of frontend connections aborted",
+		nil, nil,
+	)
+	clientConnectionsConnectedDesc = prometheus.NewDesc(
+		"proxysql_client_connections_connected",
+		"the number of frontend connections currently connected",
+		nil, nil,
+	)
+	clientConnectionsNonIdleDesc = prometheus.NewDesc(
+		"proxysql_client_connections_non_idle",
+		"the number of frontend connections currently processing a query",
+		nil, nil,
+	)
+	backendQueryTimeSecondsDesc = prometheus.NewDesc(
+		"proxysql_backend_query_time_seconds_total",
+		"the total time spent by ProxySQL waiting on backend query execution",
+		nil, nil,
+	)
+	serversTableVersionDesc = prometheus.NewDesc(
+		"proxysql_servers_table_version",
+		"the version of the mysql_servers runtime table, bumped on every change",
+		nil, nil,
+	)
+	backendBuffersBytesDesc = prometheus.NewDesc(
+		"proxysql_backend_buffers_bytes",
+		"the amount of memory currently used by network buffers for backend connections",
+		nil, nil,
+	)
+)
+
+// knownGlobalStatusMetrics maps the stats_mysql_global variables this
+// exporter understands to a dedicated Desc and the correct ValueType -
+// CounterValue for cumulative fields such as Questions or Slow_queries,
+// GaugeValue for point-in-time fields such as Client_Connections_connected -
+// instead of lumping every variable into one untyped gauge (see chunk0-2).
+var knownGlobalStatusMetrics = map[string]struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	// scale, if non-zero, is applied to the raw variable value before it is
+	// emitted (e.g. nanoseconds -> seconds).
+	scale float64
+}{
+	"Questions":                    {desc: questionsDesc, valueType: prometheus.CounterValue},
+	"Slow_queries":                 {desc: slowQueriesDesc, valueType: prometheus.CounterValue},
+	"Client_Connections_created":   {desc: clientConnectionsCreatedDesc, valueType: prometheus.CounterValue},
+	"Client_Connections_aborted":   {desc: clientConnectionsAbortedDesc, valueType: prometheus.CounterValue},
+	"Client_Connections_connected": {desc: clientConnectionsConnectedDesc, valueType: prometheus.GaugeValue},
+	"Client_Connections_non_idle":  {desc: clientConnectionsNonIdleDesc, valueType: prometheus.GaugeValue},
+	"Backend_query_time_nsec":      {desc: backendQueryTimeSecondsDesc, valueType: prometheus.CounterValue, scale: 1e-9},
+	"Servers_table_version":        {desc: serversTableVersionDesc, valueType: prometheus.GaugeValue},
+	"mysql_backend_buffers_bytes":  {desc: backendBuffersBytesDesc, valueType: prometheus.GaugeValue},
+}
+
+func describeGlobal(ch chan<- *prometheus.Desc) {
+	ch <- globalStatusDesc
+	for _, m := range knownGlobalStatusMetrics {
+		ch <- m.desc
+	}
+}
+
+// collectGlobal retrieves stats.stats_mysql_global and emits a properly
+// typed metric for each variable in knownGlobalStatusMetrics, falling back
+// to the generic globalStatusDesc gauge for everything else.
+func collectGlobal(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	query := `select Variable_Name, Variable_Value from stats.stats_mysql_global`
+	logger.Debug("Executing mysql_global query", "sql", query)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "mysql_global", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return err
+		}
+
+		v, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			logger.Debug("Skipping non-numeric mysql_global variable", "variable", name, "value", value)
+			continue
+		}
+
+		if known, ok := knownGlobalStatusMetrics[name]; ok {
+			if known.scale != 0 {
+				v *= known.scale
+			}
+			ch <- prometheus.MustNewConstMetric(known.desc, known.valueType, v)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(globalStatusDesc, prometheus.GaugeValue, v, name)
+	}
+	return rows.Err()
+}
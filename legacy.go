@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// This file preserves the exporter's original behavior: a single background
+// goroutine polls ProxySQL every --scrape.interval instead of scraping fresh
+// on every /metrics request. It is kept as an opt-in
+// (--scrape.legacy-polling) for deployments that relied on that behavior.
+//
+// It used to duplicate every subcollector's query and row-scan logic
+// alongside connectionpool.go/querydigest.go, which let the two paths drift
+// apart (the mysql_global/memory_metrics/commands_counters/mysql_users
+// subcollectors added in collector.go were never mirrored here). Instead it
+// now wraps the same Collector the default and /probe modes use in a
+// cachingCollector, so every subcollector is available under legacy polling
+// automatically, with no per-metric duplication to keep in sync.
+
+// cachingCollector wraps a Collector and replays the metrics captured by its
+// last successful poll on every Collect call, rather than querying ProxySQL
+// on each /metrics request.
+type cachingCollector struct {
+	inner *Collector
+
+	mu     sync.Mutex
+	cached []prometheus.Metric
+}
+
+func newCachingCollector(inner *Collector) *cachingCollector {
+	return &cachingCollector{inner: inner}
+}
+
+// Describe implements prometheus.Collector.
+func (c *cachingCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.inner.Describe(ch)
+}
+
+// Collect implements prometheus.Collector, serving the metrics captured by
+// the most recent call to poll.
+func (c *cachingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	cached := c.cached
+	c.mu.Unlock()
+
+	for _, m := range cached {
+		ch <- m
+	}
+}
+
+// poll runs one scrape of the wrapped Collector and replaces the cached
+// metrics with its output, so the next /metrics request serves these values
+// without blocking on ProxySQL.
+func (c *cachingCollector) poll() {
+	buf := make(chan prometheus.Metric, 256)
+	collected := make([]prometheus.Metric, 0, 256)
+	done := make(chan struct{})
+
+	go func() {
+		for m := range buf {
+			collected = append(collected, m)
+		}
+		close(done)
+	}()
+
+	c.inner.Collect(buf)
+	close(buf)
+	<-done
+
+	c.mu.Lock()
+	c.cached = collected
+	c.mu.Unlock()
+}
+
+// legacyGetStats polls mysqlDSN forever, every scrapeInterval, through a
+// Collector wrapped in a cachingCollector, and never returns. enabled
+// selects which subcollectors run, same as the default and /probe modes.
+func legacyGetStats(logger *slog.Logger, mysqlDSN string, queryDigestOpts QueryDigestOptions, adminSlowThreshold time.Duration, scrapeInterval time.Duration, enabled map[string]bool) {
+	db, err := NewConnect(logger, mysqlDSN)
+	if err != nil {
+		logger.Error("DB connection error", "err", err)
+		os.Exit(1)
+	}
+
+	cc := newCachingCollector(NewCollector(context.Background(), db, queryDigestOpts, enabled, adminSlowThreshold, logger))
+	prometheus.MustRegister(cc)
+
+	for {
+		cc.poll()
+		time.Sleep(scrapeInterval)
+	}
+}
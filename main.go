@@ -1,404 +1,139 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
-	"time"
 
-	log "github.com/sirupsen/logrus"
+	kingpin "github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/promslog"
+	promslogflag "github.com/prometheus/common/promslog/flag"
+	"github.com/prometheus/exporter-toolkit/web"
+	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var globalDB *sql.DB
-
 var (
-	up              *prometheus.GaugeVec
-	connectionError *prometheus.GaugeVec
-	connectionOK    *prometheus.GaugeVec
-	connectionUsed  *prometheus.GaugeVec
-	connectionFree  *prometheus.GaugeVec
-	queries         *prometheus.GaugeVec
-	sentBytes       *prometheus.GaugeVec
-	recvBytes       *prometheus.GaugeVec
-	latencyNs       *prometheus.GaugeVec
-	countStar       *prometheus.GaugeVec
-	minTime         *prometheus.GaugeVec
-	maxTime         *prometheus.GaugeVec
+	mysqlDSN = kingpin.Flag("mysql.dsn", "ProxySQL admin DSN for single-target scraping.").
+			Envar("MYSQL_DSN").String()
+	configFile = kingpin.Flag("config.file", "Path to the YAML file defining auth_modules for /probe.").
+			Envar("CONFIG_FILE").String()
+	telemetryPath = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").
+			Default("/metrics").String()
+	queryDigestInclude = kingpin.Flag("collect.query_digest.include", "Comma-separated digest_text patterns to include.").
+				Envar("INCLUDE_QUERY_PATTERN").String()
+	queryDigestExclude = kingpin.Flag("collect.query_digest.exclude", "Comma-separated digest_text patterns to exclude.").
+				Envar("EXCLUDE_QUERY_PATTERN").String()
+	queryDigestMatch = kingpin.Flag("collect.query_digest.match", "How to match collect.query_digest.include/exclude patterns against digest_text.").
+				Default("like").Enum("like", "regexp", "glob")
+	queryDigestLimit = kingpin.Flag("collect.query_digest.limit", "Maximum number of query digests to return per scrape; 0 means unlimited.").
+				Default("10").Int()
+	queryDigestMinCount = kingpin.Flag("collect.query_digest.min-count", "Drop digests with fewer than this many cumulative executions; 0 disables the filter.").
+				Default("0").Int()
+	queryDigestMaxLabelLength = kingpin.Flag("collect.query_digest.max-label-length", "Truncate the digest_text label to this many bytes; 0 disables truncation.").
+					Default("120").Int()
+	scrapeInterval = kingpin.Flag("scrape.interval", "Polling interval used by --scrape.legacy-polling.").
+			Default("9s").Duration()
+	legacyPolling = kingpin.Flag("scrape.legacy-polling", "Poll --mysql.dsn in the background instead of scraping /metrics on demand (legacy behavior).").
+			Envar("LEGACY_POLLING").Bool()
+	adminSlowThreshold = kingpin.Flag("admin.slow-threshold", "Log admin SQL queries that take longer than this to run.").
+				Default("1s").Duration()
+	enableMySQLGlobal = kingpin.Flag("collect.mysql_global", "Collect metrics from stats.stats_mysql_global.").
+				Default("true").Bool()
+	enableMemoryMetrics = kingpin.Flag("collect.memory_metrics", "Collect metrics from stats.stats_memory_metrics.").
+				Default("true").Bool()
+	enableCommandsCounters = kingpin.Flag("collect.commands_counters", "Collect per-command latency histograms from stats.stats_mysql_commands_counters.").
+				Default("true").Bool()
+	enableMySQLUsers = kingpin.Flag("collect.mysql_users", "Collect per-user connection counts from stats.stats_mysql_users.").
+				Default("true").Bool()
 )
 
-// Initialize gauges
-func init() {
-	switch os.Getenv("DEBUG") {
-	case "1", "true", "enabled":
-		log.SetLevel(log.DebugLevel)
-	}
-
-	up = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_up",
-		}, []string{})
-	prometheus.MustRegister(up)
-
-	connectionError = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_conn_error",
-			Help: "how many connections were not established successfully",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(connectionError)
-
-	connectionOK = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_conn_ok",
-			Help: "how many connections were established successfully",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(connectionOK)
-
-	connectionUsed = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_conn_used",
-			Help: "how many connections are currently used by ProxySQL for sending queries to the backend server",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(connectionUsed)
-
-	connectionFree = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_conn_free",
-			Help: "how many connections are currently free. They are kept open in order to minimize the time cost of sending a query to the backend server",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(connectionFree)
-
-	queries = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_queries",
-			Help: "the number of queries routed towards this particular backend server",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(queries)
-
-	sentBytes = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_sent_bytes",
-			Help: "the amount of data sent to the backend. This does not include metadata (packets headers)",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(sentBytes)
-
-	recvBytes = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_recv_bytes",
-			Help: "the amount of data received from the backend. This does not include metadata (packets headers, OK/ERR packets, fields description, etc)",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(recvBytes)
-
-	latencyNs = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_latency_ns",
-			Help: "the current ping time in microseconds, as reported from Monitor",
-		}, []string{"hostgroup", "srv_host", "srv_port", "status"})
-	prometheus.MustRegister(latencyNs)
-
-	countStar = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_query_count_total",
-			Help: "the total number of times the query has been executed (with different values for the parameters)",
-		}, []string{"hostgroup", "schemaname", "digest", "digest_text"})
-	prometheus.MustRegister(countStar)
-
-	minTime = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_query_min_time",
-			Help: "the total time in microseconds spent executing queries of this type",
-		}, []string{"hostgroup", "schemaname", "digest", "digest_text"})
-	prometheus.MustRegister(minTime)
-
-	maxTime = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "proxysql_query_max_time",
-			Help: "the total time in microseconds spent executing queries of this type",
-		}, []string{"hostgroup", "schemaname", "digest", "digest_text"})
-	prometheus.MustRegister(maxTime)
-}
-
 func main() {
-	var lIncludeQPattern []string
-	var lExcludeQPattern []string
-	// Get environment variables for connecting to the database
-	mysqlDSN := os.Getenv("MYSQL_DSN")
-	if len(mysqlDSN) < 1 {
-		log.Errorf("MYSQL_DNS isn't set")
-		os.Exit(1)
+	promslogConfig := &promslog.Config{}
+	promslogflag.AddFlags(kingpin.CommandLine, promslogConfig)
+	webFlagConfig := webflag.AddFlags(kingpin.CommandLine, ":9104")
+	kingpin.CommandLine.HelpFlag.Short('h')
+	kingpin.Parse()
+	logger := promslog.New(promslogConfig)
+
+	var lIncludeQPattern, lExcludeQPattern []string
+	if *queryDigestInclude != "" {
+		lIncludeQPattern = strings.Split(*queryDigestInclude, ",")
 	}
-	// Get environment variables for publishing metrics
-	socket := os.Getenv("SOCKET")
-	if len(socket) < 1 {
-		log.Errorf("SOCKET isn't set")
-		os.Exit(1)
+	if *queryDigestExclude != "" {
+		lExcludeQPattern = strings.Split(*queryDigestExclude, ",")
 	}
-	includeQPatterns, Ok := os.LookupEnv("INCLUDE_QUERY_PATTERN")
-	if Ok {
-		lIncludeQPattern = strings.Split(includeQPatterns, ",")
-	} else {
-		log.Printf("%s not set", "INCLUDE_QUERY_PATTERN")
+	queryDigestOpts := QueryDigestOptions{
+		Include:        lIncludeQPattern,
+		Exclude:        lExcludeQPattern,
+		Match:          *queryDigestMatch,
+		Limit:          *queryDigestLimit,
+		MinCount:       *queryDigestMinCount,
+		MaxLabelLength: *queryDigestMaxLabelLength,
 	}
-	excludeQPatterns, Ok := os.LookupEnv("EXCLUDE_QUERY_PATTERN")
-	if Ok {
-		lExcludeQPattern = strings.Split(excludeQPatterns, ",")
-	} else {
-		log.Printf("%s not set", "EXCLUDE_QUERY_PATTERN")
+
+	// defaultEnabled governs which subcollectors run when a scrape does not
+	// explicitly select a subset via the /probe collect[] parameter.
+	defaultEnabled := map[string]bool{
+		"connection_pool":   true,
+		"query_digest":      true,
+		"mysql_global":      *enableMySQLGlobal,
+		"memory_metrics":    *enableMemoryMetrics,
+		"commands_counters": *enableCommandsCounters,
+		"mysql_users":       *enableMySQLUsers,
 	}
-	// start a routine for collecting metrics
-	go GetStats(mysqlDSN, lIncludeQPattern, lExcludeQPattern)
-	// publication of metrics
-	log.Printf("Listen on %v", socket)
-	http.Handle("/metrics", promhttp.Handler())
-	log.Println(http.ListenAndServe(socket, nil))
-}
 
-func NewConnect(mysqlDSN string) (*sql.DB, error) {
-	var err error
-	if globalDB == nil {
-		globalDB, err = sql.Open("mysql", mysqlDSN)
+	// The /probe endpoint scrapes arbitrary targets on demand, authenticating
+	// with a named auth_module loaded from --config.file. It is available
+	// regardless of which single-target mode is selected below.
+	if *configFile != "" {
+		config, err := LoadConfig(*configFile)
 		if err != nil {
-			return nil, err
+			logger.Error("Loading config file failed", "file", *configFile, "err", err)
+			os.Exit(1)
 		}
-		return globalDB, nil
-	}
-	log.Debugf("Reuse conncection")
-	return globalDB, nil
-}
-
-func makeWhere(lPattern []string, entryType bool) string {
-	var (
-		where    string
-		union    string
-		negation string
-	)
-
-	if entryType {
-		union = "or"
-		negation = ""
+		http.Handle("/probe", newProbeHandler(config, queryDigestOpts, *adminSlowThreshold, defaultEnabled, logger))
 	} else {
-		union = "and"
-		negation = "not"
-	}
-	if len(lPattern) != 0 {
-		where += "and ("
-		for i, pattern := range lPattern {
-			if len(pattern) != 0 {
-				if i != 0 {
-					where += fmt.Sprintf(" %s ", union)
-				}
-				where += fmt.Sprintf("digest_text %s like %v", negation, strings.Trim(pattern, " "))
-			} else {
-				log.Errorf("The value of variable number %d from patternType=%v is empty", i, entryType)
-				os.Exit(1)
-			}
-		}
-		where += ")"
+		logger.Info("--config.file not set, /probe endpoint disabled")
 	}
-	return where
-}
 
-// Get statistics from memory DB proxysql
-func GetStats(mysqlDSN string, lIncludeQPattern []string, lExcludeQPattern []string) {
-	var err error
-	var db *sql.DB
-	for {
-		db, err = NewConnect(mysqlDSN)
-		if err != nil {
-			log.Errorf("DB connection error. %v. Try in 9 seconds", err)
-			up.With(prometheus.Labels{}).Set(float64(0))
-			time.Sleep(time.Second * 9)
-			continue
-		}
-		// collection of metrics for MySQL connections
-		err = GetStatConnectionPool(db)
+	switch {
+	case *mysqlDSN == "":
+		logger.Info("--mysql.dsn not set, single-target scraping disabled")
+	case *legacyPolling:
+		// Backward-compatible mode: a background goroutine polls --mysql.dsn
+		// every --scrape.interval and /metrics serves the last polled values.
+		go legacyGetStats(logger, *mysqlDSN, queryDigestOpts, *adminSlowThreshold, *scrapeInterval, defaultEnabled)
+	default:
+		// Default mode: --mysql.dsn is scraped fresh on every /metrics request.
+		// This Collector is registered once at startup rather than per-request
+		// (unlike /probe), so its queries run with context.Background() and
+		// cannot be cancelled by an individual scrape's client disconnecting.
+		db, err := NewConnect(logger, *mysqlDSN)
 		if err != nil {
-			log.Errorf("Query get connection_pool execute error: %v. Try in 9 seconds", err)
-			up.With(prometheus.Labels{}).Set(float64(0))
-			time.Sleep(time.Second * 9)
-			continue
+			logger.Error("DB connection error", "err", err)
+			os.Exit(1)
 		}
-		// collection of metrics for MySQL queries
-		err = GetStatQueryDigest(db, lIncludeQPattern, lExcludeQPattern)
-		if err != nil {
-			log.Errorf("Query get query_digest execute error: %v. Try in 9 seconds", err)
-			up.With(prometheus.Labels{}).Set(float64(0))
-			time.Sleep(time.Second * 9)
-			continue
-		}
-
-		up.With(prometheus.Labels{}).Set(float64(1))
-
-		time.Sleep(time.Second * 9)
-	}
-	defer db.Close()
-}
-
-// retrieves stats from stats.stats_mysql_connection_pool table
-func GetStatConnectionPool(db *sql.DB) error {
-	var err error
-	var rows *sql.Rows
-
-	sql := fmt.Sprint(`select ifnull(hg.comment, cast(cp.hostgroup as varchar)) as hostgroup,
-		cp.srv_host, cp.srv_port, cp.status, cp.ConnUsed, cp.ConnFree, cp.ConnOK, cp.ConnERR, cp.MaxConnUsed, cp.Queries, cp.Queries_GTID_sync, cp.Bytes_data_sent, cp.Bytes_data_recv, cp.Latency_us
-	from stats.stats_mysql_connection_pool cp
-		left join runtime_mysql_replication_hostgroups hg on cp.hostgroup = hg.writer_hostgroup or cp.hostgroup = hg.reader_hostgroup`)
-	log.Debugln(sql)
-
-	rows, err = db.Query(sql)
-	if err != nil {
-		return err
+		prometheus.MustRegister(NewCollector(context.Background(), db, queryDigestOpts, defaultEnabled, *adminSlowThreshold, logger))
 	}
 
-	for rows.Next() {
-		var (
-			hostgroup       string
-			srvHost         string
-			srvPort         int
-			status          string
-			ConnUsed        int
-			ConnFree        int
-			ConnOK          int
-			ConnERR         int
-			MaxConnUsed     int
-			Queries         int
-			QueriesGTIDSync int
-			BytesDataSent   int
-			BytesDataRecv   int
-			LatencyUs       int
-		)
-		err = rows.Scan(&hostgroup, &srvHost, &srvPort, &status, &ConnUsed, &ConnFree, &ConnOK, &ConnERR, &MaxConnUsed, &Queries, &QueriesGTIDSync, &BytesDataSent, &BytesDataRecv, &LatencyUs)
-		if err != nil {
-			return err
-		}
-
-		log.Debugln(hostgroup, srvHost, srvPort, status, ConnUsed, ConnFree, ConnOK, ConnERR, MaxConnUsed, Queries, QueriesGTIDSync, BytesDataSent, BytesDataRecv, LatencyUs)
-
-		connectionError.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(ConnERR))
-
-		connectionOK.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(ConnOK))
-
-		connectionUsed.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(ConnUsed))
-
-		connectionFree.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(ConnFree))
-
-		queries.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(Queries))
-
-		sentBytes.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(BytesDataSent))
-
-		recvBytes.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(BytesDataRecv))
-
-		latencyNs.With(prometheus.Labels{
-			"hostgroup": hostgroup,
-			"srv_host":  srvHost,
-			"srv_port":  fmt.Sprintf("%v", srvPort),
-			"status":    status,
-		}).Set(float64(LatencyUs))
+	http.Handle(*telemetryPath, promhttp.Handler())
+	server := &http.Server{}
+	if err := web.ListenAndServe(server, webFlagConfig, goKitLogger{logger}); err != nil {
+		logger.Error("Listen failed", "err", err)
+		os.Exit(1)
 	}
-	return nil
 }
 
-// retrieves stats from stats.stats_mysql_query_digest table
-func GetStatQueryDigest(db *sql.DB, lIncludeQPattern []string, lExcludeQPattern []string) error {
-	var err error
-	var rows *sql.Rows
-
-	sql := fmt.Sprintf(`select ifnull(hg.comment, cast(qd.hostgroup as varchar)) as hostgroup,
-		qd.schemaname,
-		qd.digest,
-		qd.digest_text,
-		sum(qd.count_star) as count_star,
-		min(qd.min_time) as min_time,
-		max(qd.max_time) as max_time
-	from stats_mysql_query_digest qd
-		left join runtime_mysql_replication_hostgroups hg on qd.hostgroup = hg.writer_hostgroup or qd.hostgroup = hg.reader_hostgroup
-	where (1=1) %s %s 
-	group by ifnull(hg.comment, cast(qd.hostgroup as varchar)), qd.schemaname, qd.digest, qd.digest_text order by qd.count_star desc
-	limit 10`, makeWhere(lIncludeQPattern, true), makeWhere(lExcludeQPattern, false))
-	log.Debugln(sql)
-
-	rows, err = db.Query(sql)
-	if err != nil {
-		return err
-	}
-
-	for rows.Next() {
-		var (
-			hostgroup   string
-			schemaname  string
-			digest      string
-			digest_text string
-			count_star  int
-			min_time    int
-			max_time    int
-		)
-		err = rows.Scan(&hostgroup, &schemaname, &digest, &digest_text, &count_star, &min_time, &max_time)
-		if err != nil {
-			return err
-		}
-
-		log.Debugln(hostgroup, schemaname, digest, digest_text, count_star, min_time, max_time)
-
-		countStar.With(prometheus.Labels{
-			"hostgroup":   hostgroup,
-			"schemaname":  schemaname,
-			"digest":      digest,
-			"digest_text": digest_text,
-		}).Set(float64(count_star))
-
-		minTime.With(prometheus.Labels{
-			"hostgroup":   hostgroup,
-			"schemaname":  schemaname,
-			"digest":      digest,
-			"digest_text": digest_text,
-		}).Set(float64(min_time))
-
-		maxTime.With(prometheus.Labels{
-			"hostgroup":   hostgroup,
-			"schemaname":  schemaname,
-			"digest":      digest,
-			"digest_text": digest_text,
-		}).Set(float64(max_time))
-	}
-	return nil
+// NewConnect opens a ProxySQL admin connection for the default single-target
+// mode. /probe manages its own pool of target connections (see probe.go).
+func NewConnect(logger *slog.Logger, mysqlDSN string) (*sql.DB, error) {
+	logger.Debug("Opening ProxySQL admin connection")
+	return sql.Open("mysql", mysqlDSN)
 }
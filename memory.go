@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var memoryMetricsLabels = []string{"variable"}
+
+// memoryMetricsDesc is a single generic gauge for stats.stats_memory_metrics,
+// which like stats_mysql_global reports an open-ended Variable_Name/Variable_Value
+// list (jemalloc arena sizes, query cache memory, etc.). Unlike
+// stats_mysql_global, every variable here is a point-in-time memory
+// allocation rather than a cumulative count, so GaugeValue is correct across
+// the board and there is no analogous knownGlobalStatusMetrics split.
+var memoryMetricsDesc = prometheus.NewDesc(
+	"proxysql_memory_metrics_bytes",
+	"Generic gauge for a stats.stats_memory_metrics variable (see the ProxySQL docs for the full variable list).",
+	memoryMetricsLabels, nil,
+)
+
+func describeMemoryMetrics(ch chan<- *prometheus.Desc) {
+	ch <- memoryMetricsDesc
+}
+
+// collectMemoryMetrics retrieves stats.stats_memory_metrics and emits one
+// gauge per variable row.
+func collectMemoryMetrics(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	query := `select Variable_Name, Variable_Value from stats.stats_memory_metrics`
+	logger.Debug("Executing memory_metrics query", "sql", query)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "memory_metrics", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return err
+		}
+
+		v, convErr := strconv.ParseFloat(value, 64)
+		if convErr != nil {
+			logger.Debug("Skipping non-numeric memory_metrics variable", "variable", name, "value", value)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(memoryMetricsDesc, prometheus.GaugeValue, v, name)
+	}
+	return rows.Err()
+}
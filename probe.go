@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// dbPool caches admin connections opened by the /probe handler, keyed by
+// "auth_module/target", so repeated scrapes of the same instance reuse the
+// same *sql.DB (and therefore its connection pool) instead of reopening one
+// per request.
+type dbPool struct {
+	mu  sync.Mutex
+	dbs map[string]*sql.DB
+}
+
+func newDBPool() *dbPool {
+	return &dbPool{dbs: make(map[string]*sql.DB)}
+}
+
+func (p *dbPool) get(key, dsn string) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if db, ok := p.dbs[key]; ok {
+		return db, nil
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	p.dbs[key] = db
+	return db, nil
+}
+
+// probeHandler implements the multi-target /probe endpoint: it resolves the
+// requested auth_module against the loaded Config, opens (or reuses) an
+// admin connection to the requested target, and serves a fresh registry
+// containing just that target's metrics, labeled with "instance".
+type probeHandler struct {
+	config             *Config
+	pool               *dbPool
+	queryDigestOpts    QueryDigestOptions
+	adminSlowThreshold time.Duration
+	// defaultEnabled selects which subcollectors run when a request does not
+	// override the selection with its own collect[] parameter.
+	defaultEnabled map[string]bool
+	logger         *slog.Logger
+}
+
+func newProbeHandler(config *Config, queryDigestOpts QueryDigestOptions, adminSlowThreshold time.Duration, defaultEnabled map[string]bool, logger *slog.Logger) *probeHandler {
+	return &probeHandler{
+		config:             config,
+		pool:               newDBPool(),
+		queryDigestOpts:    queryDigestOpts,
+		adminSlowThreshold: adminSlowThreshold,
+		defaultEnabled:     defaultEnabled,
+		logger:             logger,
+	}
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := r.URL.Query().Get("auth_module")
+	if moduleName == "" {
+		http.Error(w, "auth_module parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	module, ok := h.config.AuthModules[moduleName]
+	if !ok {
+		http.Error(w, "unknown auth_module "+moduleName, http.StatusBadRequest)
+		return
+	}
+
+	dsn, err := module.DSN(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db, err := h.pool.get(moduleName+"/"+target, dsn)
+	if err != nil {
+		h.logger.Error("probe: opening connection failed", "target", target, "err", err)
+		http.Error(w, "could not open connection to target", http.StatusInternalServerError)
+		return
+	}
+
+	enabled := h.defaultEnabled
+	if collect, ok := r.URL.Query()["collect[]"]; ok {
+		enabled = make(map[string]bool, len(collect))
+		for _, name := range collect {
+			enabled[name] = true
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	instanceRegistry := prometheus.WrapRegistererWith(prometheus.Labels{"instance": target}, registry)
+	instanceRegistry.MustRegister(NewCollector(r.Context(), db, h.queryDigestOpts, enabled, h.adminSlowThreshold, h.logger))
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queryDigestLabels = []string{"hostgroup", "schemaname", "digest", "digest_text"}
+
+var (
+	countStarDesc = prometheus.NewDesc(
+		"proxysql_query_count_total",
+		"the total number of times the query has been executed (with different values for the parameters)",
+		queryDigestLabels, nil,
+	)
+	minTimeDesc = prometheus.NewDesc(
+		"proxysql_query_min_time",
+		"the total time in microseconds spent executing queries of this type",
+		queryDigestLabels, nil,
+	)
+	maxTimeDesc = prometheus.NewDesc(
+		"proxysql_query_max_time",
+		"the total time in microseconds spent executing queries of this type",
+		queryDigestLabels, nil,
+	)
+)
+
+// QueryDigestOptions configures how collectQueryDigest filters and limits
+// the rows it reads from stats_mysql_query_digest.
+type QueryDigestOptions struct {
+	Include []string
+	Exclude []string
+	// Match selects the SQL operator Include/Exclude patterns are compared
+	// with: "like", "regexp" or "glob" (all understood by ProxySQL's
+	// SQLite-based admin interface).
+	Match string
+	// Limit caps the number of digests returned, ordered by count_star
+	// descending; 0 means unlimited.
+	Limit int
+	// MinCount drops digests whose cumulative count_star is below this
+	// value; 0 disables the filter.
+	MinCount int
+	// MaxLabelLength truncates the digest_text label to this many bytes
+	// (appending a short hash of the full text) so a handful of long,
+	// highly-distinct normalized queries cannot blow up label cardinality;
+	// 0 disables truncation.
+	MaxLabelLength int
+}
+
+func describeQueryDigest(ch chan<- *prometheus.Desc) {
+	ch <- countStarDesc
+	ch <- minTimeDesc
+	ch <- maxTimeDesc
+}
+
+// matchOperator maps a --collect.query_digest.match mode to the SQL operator
+// understood by ProxySQL's SQLite-based admin interface.
+func matchOperator(match string) string {
+	switch match {
+	case "regexp":
+		return "regexp"
+	case "glob":
+		return "glob"
+	default:
+		return "like"
+	}
+}
+
+// makeWhere builds a parameterized "and (...)" clause matching digest_text
+// against lPattern using the given match mode, returning the clause and its
+// bind arguments separately so callers pass them straight to db.Query -
+// patterns are never interpolated into the SQL text itself.
+func makeWhere(logger *slog.Logger, lPattern []string, entryType bool, match string) (string, []interface{}) {
+	var (
+		clauses  []string
+		args     []interface{}
+		union    string
+		negation string
+	)
+
+	if entryType {
+		union = "or"
+		negation = ""
+	} else {
+		union = "and"
+		negation = "not"
+	}
+
+	op := matchOperator(match)
+	for i, pattern := range lPattern {
+		pattern = strings.Trim(pattern, " ")
+		if pattern == "" {
+			logger.Error("Empty query pattern", "index", i, "is_include", entryType)
+			os.Exit(1)
+		}
+		clauses = append(clauses, fmt.Sprintf("digest_text %s %s ?", negation, op))
+		args = append(args, pattern)
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return "and (" + strings.Join(clauses, " "+union+" ") + ")", args
+}
+
+// truncateLabel shortens text to at most maxLen bytes, replacing the
+// overflow with a short fnv hash of the full string so two long, distinct
+// digest_texts that share a common prefix still produce distinct labels.
+// maxLen <= 0 disables truncation.
+func truncateLabel(text string, maxLen int) string {
+	if maxLen <= 0 || len(text) <= maxLen {
+		return text
+	}
+	sum := fnv.New32a()
+	sum.Write([]byte(text))
+	suffix := fmt.Sprintf("...<%08x>", sum.Sum32())
+	cut := maxLen - len(suffix)
+	if cut < 0 {
+		cut = 0
+	}
+	return text[:cut] + suffix
+}
+
+// collectQueryDigest retrieves stats from stats.stats_mysql_query_digest and
+// emits one set of metrics per hostgroup/schema/digest row.
+func collectQueryDigest(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, opts QueryDigestOptions, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	includeWhere, includeArgs := makeWhere(logger, opts.Include, true, opts.Match)
+	excludeWhere, excludeArgs := makeWhere(logger, opts.Exclude, false, opts.Match)
+
+	var having string
+	var havingArgs []interface{}
+	if opts.MinCount > 0 {
+		having = "having sum(qd.count_star) >= ?"
+		havingArgs = append(havingArgs, opts.MinCount)
+	}
+
+	var limitClause string
+	var limitArgs []interface{}
+	if opts.Limit > 0 {
+		limitClause = "limit ?"
+		limitArgs = append(limitArgs, opts.Limit)
+	}
+
+	query := fmt.Sprintf(`select ifnull(hg.comment, cast(qd.hostgroup as varchar)) as hostgroup,
+		qd.schemaname,
+		qd.digest,
+		qd.digest_text,
+		sum(qd.count_star) as count_star,
+		min(qd.min_time) as min_time,
+		max(qd.max_time) as max_time
+	from stats_mysql_query_digest qd
+		left join runtime_mysql_replication_hostgroups hg on qd.hostgroup = hg.writer_hostgroup or qd.hostgroup = hg.reader_hostgroup
+	where (1=1) %s %s
+	group by ifnull(hg.comment, cast(qd.hostgroup as varchar)), qd.schemaname, qd.digest, qd.digest_text
+	%s
+	order by count_star desc
+	%s`, includeWhere, excludeWhere, having, limitClause)
+
+	args := append(append(append([]interface{}{}, includeArgs...), excludeArgs...), havingArgs...)
+	args = append(args, limitArgs...)
+
+	logger.Debug("Executing query_digest query", "sql", query, "args", args)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "query_digest", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var (
+			hostgroup   string
+			schemaname  string
+			digest      string
+			digest_text string
+			count_star  int
+			min_time    int
+			max_time    int
+		)
+		err = rows.Scan(&hostgroup, &schemaname, &digest, &digest_text, &count_star, &min_time, &max_time)
+		if err != nil {
+			return err
+		}
+
+		logger.Debug("query_digest row", "hostgroup", hostgroup, "schemaname", schemaname, "digest", digest)
+
+		labels := []string{hostgroup, schemaname, digest, truncateLabel(digest_text, opts.MaxLabelLength)}
+
+		ch <- prometheus.MustNewConstMetric(countStarDesc, prometheus.CounterValue, float64(count_star), labels...)
+		ch <- prometheus.MustNewConstMetric(minTimeDesc, prometheus.GaugeValue, float64(min_time), labels...)
+		ch <- prometheus.MustNewConstMetric(maxTimeDesc, prometheus.GaugeValue, float64(max_time), labels...)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestMakeWhere(t *testing.T) {
+	cases := []struct {
+		name      string
+		patterns  []string
+		entryType bool
+		match     string
+		wantOp    string
+		wantUnion string
+		wantNeg   bool
+	}{
+		{
+			name:      "include like",
+			patterns:  []string{"select %", "update %"},
+			entryType: true,
+			match:     "like",
+			wantOp:    "like",
+			wantUnion: "or",
+			wantNeg:   false,
+		},
+		{
+			name:      "exclude regexp",
+			patterns:  []string{"^select", "127.0.0.1:6032)/x?allowAllFiles=true"},
+			entryType: false,
+			match:     "regexp",
+			wantOp:    "regexp",
+			wantUnion: "and",
+			wantNeg:   true,
+		},
+		{
+			name:      "no patterns",
+			patterns:  nil,
+			entryType: true,
+			match:     "like",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clause, args := makeWhere(testLogger(), c.patterns, c.entryType, c.match)
+
+			if len(c.patterns) == 0 {
+				if clause != "" || args != nil {
+					t.Fatalf("makeWhere(%v) = %q, %v; want empty clause and nil args", c.patterns, clause, args)
+				}
+				return
+			}
+
+			if len(args) != len(c.patterns) {
+				t.Fatalf("makeWhere(%v) returned %d args, want %d", c.patterns, len(args), len(c.patterns))
+			}
+			for i, p := range c.patterns {
+				if args[i] != p {
+					t.Errorf("args[%d] = %v, want %q", i, args[i], p)
+				}
+				// The pattern must never be interpolated into the clause
+				// itself - it must only ever appear via the bound args.
+				if strings.Contains(clause, p) {
+					t.Errorf("makeWhere clause %q contains raw pattern %q; patterns must be bound via ?, not interpolated", clause, p)
+				}
+			}
+
+			if !strings.Contains(clause, c.wantOp) {
+				t.Errorf("clause %q does not contain expected operator %q", clause, c.wantOp)
+			}
+			if !strings.Contains(clause, c.wantUnion) {
+				t.Errorf("clause %q does not contain expected union %q", clause, c.wantUnion)
+			}
+			if c.wantNeg && !strings.Contains(clause, "not") {
+				t.Errorf("clause %q should negate but does not contain \"not\"", clause)
+			}
+			if strings.Count(clause, "?") != len(c.patterns) {
+				t.Errorf("clause %q has %d placeholders, want %d", clause, strings.Count(clause, "?"), len(c.patterns))
+			}
+		})
+	}
+}
+
+func TestTruncateLabel(t *testing.T) {
+	cases := []struct {
+		name   string
+		text   string
+		maxLen int
+	}{
+		{name: "short text unchanged", text: "select * from t", maxLen: 120},
+		{name: "truncation disabled", text: strings.Repeat("x", 200), maxLen: 0},
+		{name: "truncation disabled negative", text: strings.Repeat("x", 200), maxLen: -1},
+		{name: "long text truncated", text: strings.Repeat("a", 200), maxLen: 40},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := truncateLabel(c.text, c.maxLen)
+
+			if c.maxLen <= 0 {
+				if got != c.text {
+					t.Fatalf("truncateLabel(_, %d) = %q, want unchanged %q", c.maxLen, got, c.text)
+				}
+				return
+			}
+
+			if len(c.text) <= c.maxLen {
+				if got != c.text {
+					t.Fatalf("truncateLabel(%q, %d) = %q, want unchanged", c.text, c.maxLen, got)
+				}
+				return
+			}
+
+			if len(got) > c.maxLen {
+				t.Errorf("truncateLabel(_, %d) = %q (len %d), want len <= %d", c.maxLen, got, len(got), c.maxLen)
+			}
+			if !strings.HasPrefix(got, c.text[:10]) {
+				t.Errorf("truncateLabel(%q, %d) = %q, want it to retain the original prefix", c.text, c.maxLen, got)
+			}
+
+			// The truncation must be deterministic, since the digest_text
+			// label must stay stable across scrapes of the same query.
+			again := truncateLabel(c.text, c.maxLen)
+			if got != again {
+				t.Errorf("truncateLabel is not deterministic: %q != %q", got, again)
+			}
+		})
+	}
+}
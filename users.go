@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var mysqlUsersLabels = []string{"username"}
+
+var (
+	userFrontendConnectionsDesc = prometheus.NewDesc(
+		"proxysql_user_frontend_connections",
+		"the number of frontend connections currently established for this user",
+		mysqlUsersLabels, nil,
+	)
+	userFrontendMaxConnectionsDesc = prometheus.NewDesc(
+		"proxysql_user_frontend_max_connections",
+		"the configured maximum number of frontend connections allowed for this user",
+		mysqlUsersLabels, nil,
+	)
+)
+
+func describeMySQLUsers(ch chan<- *prometheus.Desc) {
+	ch <- userFrontendConnectionsDesc
+	ch <- userFrontendMaxConnectionsDesc
+}
+
+// collectMySQLUsers retrieves stats.stats_mysql_users and emits one set of
+// metrics per user row.
+func collectMySQLUsers(ctx context.Context, logger *slog.Logger, threshold time.Duration, db *sql.DB, ch chan<- prometheus.Metric) error {
+	var err error
+	var rows *sql.Rows
+	var rowCount int
+
+	query := `select username, frontend_connections, frontend_max_connections from stats.stats_mysql_users`
+	logger.Debug("Executing mysql_users query", "sql", query)
+
+	start := time.Now()
+	defer func() { observeAdminQuery(logger, threshold, "mysql_users", query, start, rowCount) }()
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rowCount++
+		var (
+			username               string
+			frontendConnections    int
+			frontendMaxConnections int
+		)
+		if err = rows.Scan(&username, &frontendConnections, &frontendMaxConnections); err != nil {
+			return err
+		}
+
+		logger.Debug("mysql_users row", "username", username)
+
+		ch <- prometheus.MustNewConstMetric(userFrontendConnectionsDesc, prometheus.GaugeValue, float64(frontendConnections), username)
+		ch <- prometheus.MustNewConstMetric(userFrontendMaxConnectionsDesc, prometheus.GaugeValue, float64(frontendMaxConnections), username)
+	}
+	return rows.Err()
+}
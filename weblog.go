@@ -0,0 +1,15 @@
+package main
+
+import "log/slog"
+
+// goKitLogger adapts a *slog.Logger to the minimal go-kit/log.Logger
+// interface (Log(keyvals ...interface{}) error) expected by
+// exporter-toolkit/web, which has not yet migrated to log/slog.
+type goKitLogger struct {
+	logger *slog.Logger
+}
+
+func (l goKitLogger) Log(keyvals ...interface{}) error {
+	l.logger.Info("", keyvals...)
+	return nil
+}